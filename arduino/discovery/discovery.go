@@ -0,0 +1,407 @@
+/*
+ * This file is part of arduino-cli.
+ *
+ * Copyright 2018 ARDUINO SA (http://www.arduino.cc/)
+ *
+ * This software is released under the GNU General Public License version 3,
+ * which covers the main part of arduino-cli.
+ * The terms of this license can be found at:
+ * https://www.gnu.org/licenses/gpl-3.0.en.html
+ *
+ * You can be released from the requirements of the above licenses by purchasing
+ * a commercial license. Buying such a license is mandatory if you want to modify or
+ * otherwise use the software for commercial activities involving the Arduino
+ * software without disclosing the source code of your own applications. To purchase
+ * a commercial license, send an email to license@arduino.cc.
+ */
+
+// Package discovery implements a client for the Pluggable Discovery
+// protocol: a simple line-based JSON protocol spoken over the stdin/stdout
+// of an external tool, used by arduino-cli to enumerate the boards attached
+// to the machine (over serial, network, BLE, ...).
+package discovery
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion identifies a revision of the Pluggable Discovery protocol,
+// as negotiated with a discovery tool via the HELLO handshake.
+type ProtocolVersion int
+
+const (
+	// ProtocolVersionLegacy is assumed for discoveries that don't answer the
+	// HELLO handshake within helloTimeout, for backward compatibility with
+	// tools written before the handshake was introduced.
+	ProtocolVersionLegacy ProtocolVersion = 0
+	// ProtocolVersion1 adds the HELLO handshake and reports port identification
+	// data as a single "properties" object instead of separate prefs fields.
+	ProtocolVersion1 ProtocolVersion = 1
+)
+
+// maxSupportedProtocolVersion is the newest protocol version this client
+// knows how to speak; HELLO negotiation fails if the discovery requires newer.
+const maxSupportedProtocolVersion = ProtocolVersion1
+
+// helloTimeout bounds how long we wait for a HELLO response before falling
+// back to ProtocolVersionLegacy for tools that predate the handshake.
+const helloTimeout = 500 * time.Millisecond
+
+// userAgent is sent as part of the HELLO handshake to identify the client.
+const userAgent = "arduino-cli"
+
+// ErrTimeout is returned by List when the discovery doesn't answer within
+// its configured Timeout.
+var ErrTimeout = errors.New("timed out waiting for discovery response")
+
+// ProtocolError wraps a v1 error-event ({"eventType":"error","error":true,
+// "message":"..."}) reported by a discovery, as opposed to a transport or
+// parsing failure on the client side.
+type ProtocolError struct {
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
+
+// Discovery is a client for a pluggable discovery tool spawned as a
+// subprocess and driven over its standard input/output.
+type Discovery struct {
+	// Timeout is used for the LIST command and, for legacy (v0) discoveries,
+	// bounds how long we wait for ports to be reported.
+	Timeout time.Duration
+
+	id              string
+	args            []string
+	proc            *exec.Cmd
+	stdin           io.WriteCloser
+	protocolVersion ProtocolVersion
+	supportsSync    bool
+
+	// lines is fed by the single reader goroutine started in run, which
+	// owns the underlying bufio.Scanner for the lifetime of the process.
+	// Every call that needs a line (HELLO, LIST, the sync event loop) reads
+	// from this channel instead of scanning stdout itself, so there's never
+	// more than one goroutine touching the (non-concurrency-safe) Scanner.
+	lines chan lineResult
+
+	// staleLines counts responses that readLineWithTimeout gave up waiting
+	// for (returning ErrTimeout to its caller) but that may still arrive on
+	// lines afterwards. Whoever reads next discards that many lines before
+	// returning one to its own caller, so a late response is never
+	// misattributed to an unrelated later call. Guarded by mutex.
+	staleLines int
+
+	eventChan chan *Event
+
+	mutex sync.Mutex
+}
+
+// lineResult is a single line read from the discovery's stdout, or the
+// error that ended the read (io.EOF once the process's output is
+// exhausted).
+type lineResult struct {
+	line string
+	err  error
+}
+
+// SupportsSync reports whether the discovery declared, in its HELLO
+// response, that it supports the START_SYNC event stream. Discoveries that
+// don't (or legacy tools that don't speak HELLO at all) must be polled with
+// List instead.
+func (d *Discovery) SupportsSync() bool {
+	return d.supportsSync
+}
+
+// ProtocolVersion returns the protocol version negotiated with the discovery
+// by NewFromCommandLine through the HELLO handshake.
+func (d *Discovery) ProtocolVersion() ProtocolVersion {
+	return d.protocolVersion
+}
+
+// NewFromCommandLine spawns the given command line as the backing tool for
+// a Discovery and performs the HELLO handshake against it. If the discovery
+// answers with a protocol version newer than this client supports, it fails
+// with a clear error rather than proceeding with a protocol it can't speak;
+// if it doesn't answer HELLO at all within helloTimeout, the client assumes
+// a legacy (pre-handshake) tool and falls back to ProtocolVersionLegacy.
+func NewFromCommandLine(cmdLine ...string) (*Discovery, error) {
+	if len(cmdLine) == 0 {
+		return nil, errors.New("invalid discovery command line")
+	}
+	d := &Discovery{
+		id:   cmdLine[0],
+		args: cmdLine[1:],
+	}
+	if err := d.run(); err != nil {
+		return nil, err
+	}
+
+	version, supportsSync, err := d.negotiateProtocolVersion()
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	d.protocolVersion = version
+	d.supportsSync = supportsSync
+	return d, nil
+}
+
+// run spawns the discovery subprocess and wires up its stdin/stdout, if not
+// already running.
+func (d *Discovery) run() error {
+	if d.proc != nil {
+		return nil
+	}
+	proc := exec.Command(d.id, d.args...)
+	stdin, err := proc.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("connecting to discovery stdin: %w", err)
+	}
+	stdout, err := proc.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("connecting to discovery stdout: %w", err)
+	}
+	if err := proc.Start(); err != nil {
+		return fmt.Errorf("starting discovery process: %w", err)
+	}
+	d.proc = proc
+	d.stdin = stdin
+	d.lines = make(chan lineResult)
+	go d.readLoop(bufio.NewScanner(stdout))
+	return nil
+}
+
+// readLoop is the single goroutine allowed to touch the discovery's stdout
+// Scanner. It runs for the lifetime of the process, pushing every line it
+// reads onto d.lines; once the discovery's output ends, it keeps re-sending
+// the terminal error so callers racing to read after the process has exited
+// get it immediately instead of blocking forever.
+func (d *Discovery) readLoop(stdout *bufio.Scanner) {
+	for stdout.Scan() {
+		d.lines <- lineResult{line: stdout.Text()}
+	}
+	err := stdout.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	for {
+		d.lines <- lineResult{err: err}
+	}
+}
+
+// Start issues the START command, telling the discovery to begin looking
+// for ports. The protocol version has already been negotiated by the time
+// Start is called, in NewFromCommandLine.
+func (d *Discovery) Start() error {
+	return d.sendCommand("START")
+}
+
+// negotiateProtocolVersion sends HELLO and waits, up to helloTimeout, for a
+// well-formed reply declaring the discovery's protocol version. Discoveries
+// that don't reply in time are assumed to be legacy (v0) tools; discoveries
+// that reply with a version newer than maxSupportedProtocolVersion cause an
+// error, since this client has no way to speak to them correctly.
+func (d *Discovery) negotiateProtocolVersion() (ProtocolVersion, bool, error) {
+	if err := d.sendCommand(fmt.Sprintf("HELLO %d %q", maxSupportedProtocolVersion, userAgent)); err != nil {
+		return ProtocolVersionLegacy, false, nil
+	}
+
+	line, err := d.readLineWithTimeout(helloTimeout)
+	if err != nil {
+		// No response (or the wait timed out): assume a legacy tool rather
+		// than failing outright.
+		return ProtocolVersionLegacy, false, nil
+	}
+
+	var resp struct {
+		EventType       string `json:"eventType"`
+		ProtocolVersion int    `json:"protocolVersion"`
+		Message         string `json:"message"`
+		StartSync       bool   `json:"startSync"`
+	}
+	if err := json.Unmarshal([]byte(line), &resp); err != nil || resp.EventType != "hello" {
+		return ProtocolVersionLegacy, false, nil
+	}
+
+	version := ProtocolVersion(resp.ProtocolVersion)
+	if version > maxSupportedProtocolVersion {
+		return 0, false, fmt.Errorf("discovery %s requires protocol version %d, but this version of arduino-cli only supports up to %d",
+			d.id, version, maxSupportedProtocolVersion)
+	}
+	return version, resp.StartSync, nil
+}
+
+// List performs a one-shot enumeration of the ports currently visible to
+// the discovery.
+func (d *Discovery) List() ([]*Port, error) {
+	if err := d.sendCommand("LIST"); err != nil {
+		return nil, err
+	}
+
+	line, err := d.readLineWithTimeout(d.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("requesting port list: %w", err)
+	}
+
+	var resp struct {
+		EventType string          `json:"eventType"`
+		Ports     []wireEventPort `json:"ports"`
+		Error     bool            `json:"error"`
+		Message   string          `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		return nil, fmt.Errorf("parsing port list: %w", err)
+	}
+	if resp.Error {
+		return nil, &ProtocolError{Message: resp.Message}
+	}
+
+	ports := make([]*Port, len(resp.Ports))
+	for i := range resp.Ports {
+		ports[i] = resp.Ports[i].normalize()
+	}
+	return ports, nil
+}
+
+// StartSync issues START_SYNC, telling the discovery to stop waiting for
+// LIST requests and instead stream add/remove events as ports come and go.
+// The events can be read from the channel returned by EventChan. Callers
+// must check SupportsSync first: discoveries that don't support it will
+// simply never produce any event.
+func (d *Discovery) StartSync() error {
+	if err := d.sendCommand("START_SYNC"); err != nil {
+		return err
+	}
+	d.eventChan = make(chan *Event)
+	go d.syncEventLoop()
+	return nil
+}
+
+// EventChan returns the channel add/remove events are delivered on after
+// StartSync. It's closed once the discovery is closed or its output ends.
+func (d *Discovery) EventChan() <-chan *Event {
+	return d.eventChan
+}
+
+// syncEventLoop reads events off the discovery's stdout for as long as the
+// process is alive and forwards add/remove/error notifications to
+// eventChan. It exits, closing eventChan, once the discovery's stdout is
+// exhausted.
+func (d *Discovery) syncEventLoop() {
+	defer close(d.eventChan)
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return
+		}
+		var resp struct {
+			EventType string        `json:"eventType"`
+			Port      wireEventPort `json:"port"`
+			Error     bool          `json:"error"`
+			Message   string        `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			continue
+		}
+		switch resp.EventType {
+		case "add":
+			d.eventChan <- &Event{Type: EventAdd, Port: resp.Port.normalize()}
+		case "remove":
+			d.eventChan <- &Event{Type: EventRemove, Port: resp.Port.normalize()}
+		case "error":
+			d.eventChan <- &Event{Type: EventError, Message: resp.Message}
+		}
+	}
+}
+
+// Close sends STOP and QUIT to the discovery and releases the subprocess.
+func (d *Discovery) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.proc == nil {
+		return nil
+	}
+	// Write directly: sendCommand would try to take d.mutex, already held here.
+	_, _ = fmt.Fprintf(d.stdin, "STOP\n")
+	_, _ = fmt.Fprintf(d.stdin, "QUIT\n")
+	_ = d.stdin.Close()
+	err := d.proc.Wait()
+	d.proc = nil
+	return err
+}
+
+func (d *Discovery) sendCommand(cmd string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, err := fmt.Fprintf(d.stdin, "%s\n", cmd)
+	return err
+}
+
+// takeIfStale reports whether res is a leftover response to a read that
+// already gave up and returned ErrTimeout to its caller, consuming one
+// pending stale slot if so. Errors are never treated as stale: once
+// readLoop starts reporting the terminal error, every call should see it
+// immediately rather than have it discarded as a late response.
+func (d *Discovery) takeIfStale(res lineResult) bool {
+	if res.err != nil {
+		return false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.staleLines == 0 {
+		return false
+	}
+	d.staleLines--
+	return true
+}
+
+// readLine returns the next line from the discovery, blocking until the
+// single reader goroutine started in run has one ready. Lines left over
+// from a previous call that timed out are silently discarded rather than
+// being handed to this call.
+func (d *Discovery) readLine() (string, error) {
+	for {
+		res := <-d.lines
+		if d.takeIfStale(res) {
+			continue
+		}
+		return res.line, res.err
+	}
+}
+
+// readLineWithTimeout reads a single line from the discovery, failing if
+// none arrives within timeout. A zero timeout means wait forever. If the
+// timeout elapses, the response may still be in flight on d.lines; rather
+// than leaving it for whichever call reads next (which would silently
+// misattribute it, permanently shifting every later read by one message),
+// this records a stale read to be discarded once it does arrive.
+func (d *Discovery) readLineWithTimeout(timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return d.readLine()
+	}
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case res := <-d.lines:
+			if d.takeIfStale(res) {
+				continue
+			}
+			return res.line, res.err
+		case <-deadline:
+			d.mutex.Lock()
+			d.staleLines++
+			d.mutex.Unlock()
+			return "", ErrTimeout
+		}
+	}
+}
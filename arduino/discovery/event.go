@@ -0,0 +1,43 @@
+/*
+ * This file is part of arduino-cli.
+ *
+ * Copyright 2018 ARDUINO SA (http://www.arduino.cc/)
+ *
+ * This software is released under the GNU General Public License version 3,
+ * which covers the main part of arduino-cli.
+ * The terms of this license can be found at:
+ * https://www.gnu.org/licenses/gpl-3.0.en.html
+ *
+ * You can be released from the requirements of the above licenses by purchasing
+ * a commercial license. Buying such a license is mandatory if you want to modify or
+ * otherwise use the software for commercial activities involving the Arduino
+ * software without disclosing the source code of your own applications. To purchase
+ * a commercial license, send an email to license@arduino.cc.
+ */
+
+package discovery
+
+// EventType identifies the kind of change an Event reports.
+type EventType string
+
+const (
+	// EventAdd is emitted when a port appears.
+	EventAdd EventType = "add"
+	// EventRemove is emitted when a port disappears.
+	EventRemove EventType = "remove"
+	// EventError is emitted when the discovery reports a v1 protocol error
+	// frame ({"eventType":"error","error":true,"message":"..."}) while it's
+	// running under START_SYNC, e.g. because it lost access to the
+	// underlying transport. Port is nil for this event type; Message holds
+	// the discovery's error text.
+	EventError EventType = "error"
+)
+
+// Event is a single notification produced by a discovery that was started
+// with StartSync: a port add/remove as the ports attached to the machine
+// change over time, or an error report from the discovery itself.
+type Event struct {
+	Type    EventType
+	Port    *Port
+	Message string
+}
@@ -0,0 +1,79 @@
+/*
+ * This file is part of arduino-cli.
+ *
+ * Copyright 2018 ARDUINO SA (http://www.arduino.cc/)
+ *
+ * This software is released under the GNU General Public License version 3,
+ * which covers the main part of arduino-cli.
+ * The terms of this license can be found at:
+ * https://www.gnu.org/licenses/gpl-3.0.en.html
+ *
+ * You can be released from the requirements of the above licenses by purchasing
+ * a commercial license. Buying such a license is mandatory if you want to modify or
+ * otherwise use the software for commercial activities involving the Arduino
+ * software without disclosing the source code of your own applications. To purchase
+ * a commercial license, send an email to license@arduino.cc.
+ */
+
+package discovery
+
+// Port is a port descriptor as reported by a pluggable discovery, either
+// through a one-shot LIST or as part of the START_SYNC event stream.
+//
+// Properties carries the set of key/value pairs a discovery attaches to the
+// port (vid, pid, serialNumber, ...) regardless of the protocol version
+// negotiated with the discovery: v0 discoveries report them under
+// "identificationPrefs"/"prefs", v1 discoveries report them under a single
+// "properties" object, but callers only ever need to look at Properties.
+type Port struct {
+	Address       string            `json:"address"`
+	AddressLabel  string            `json:"label"`
+	Protocol      string            `json:"protocol"`
+	ProtocolLabel string            `json:"protocol_label"`
+	Properties    map[string]string `json:"properties"`
+	// Error is set when the discovery reported this specific port as only
+	// partially enumerated (e.g. it saw the device but couldn't read its
+	// identification properties), as opposed to a failure of the whole
+	// LIST/START_SYNC exchange.
+	Error string `json:"-"`
+}
+
+// wireEventPort mirrors the JSON shape of a port as it appears on the wire,
+// before it's normalized into a Port. The v1 protocol reports a single
+// "properties" object; the legacy v0 protocol reports "identificationPrefs"
+// (and, on older tools still, "prefs").
+type wireEventPort struct {
+	Address             string            `json:"address"`
+	AddressLabel        string            `json:"label"`
+	Protocol            string            `json:"protocol"`
+	ProtocolLabel       string            `json:"protocol_label"`
+	Properties          map[string]string `json:"properties"`
+	IdentificationPrefs map[string]string `json:"identificationPrefs"`
+	Prefs               map[string]string `json:"prefs"`
+	Error               string            `json:"error"`
+}
+
+// normalize converts a wireEventPort into the unified Port representation
+// used by the rest of the codebase. Properties is taken from the first
+// non-nil of "properties", "identificationPrefs" and "prefs"; the protocol
+// version negotiated with the discovery is not consulted.
+func (w *wireEventPort) normalize() *Port {
+	props := w.Properties
+	if props == nil {
+		props = w.IdentificationPrefs
+	}
+	if props == nil {
+		props = w.Prefs
+	}
+	if props == nil {
+		props = map[string]string{}
+	}
+	return &Port{
+		Address:       w.Address,
+		AddressLabel:  w.AddressLabel,
+		Protocol:      w.Protocol,
+		ProtocolLabel: w.ProtocolLabel,
+		Properties:    props,
+		Error:         w.Error,
+	}
+}
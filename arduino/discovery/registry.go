@@ -0,0 +1,144 @@
+/*
+ * This file is part of arduino-cli.
+ *
+ * Copyright 2018 ARDUINO SA (http://www.arduino.cc/)
+ *
+ * This software is released under the GNU General Public License version 3,
+ * which covers the main part of arduino-cli.
+ * The terms of this license can be found at:
+ * https://www.gnu.org/licenses/gpl-3.0.en.html
+ *
+ * You can be released from the requirements of the above licenses by purchasing
+ * a commercial license. Buying such a license is mandatory if you want to modify or
+ * otherwise use the software for commercial activities involving the Arduino
+ * software without disclosing the source code of your own applications. To purchase
+ * a commercial license, send an email to license@arduino.cc.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arduino/arduino-cli/arduino/cores"
+	"github.com/arduino/arduino-cli/arduino/cores/packagemanager"
+)
+
+// Registry indexes every discovery available to the CLI, keyed by a short
+// id (e.g. "serial", "mdns", "ble") that board list --discovery-filter
+// matches against. It's populated with the builtin serial-discovery by the
+// caller via Register, and with every discovery declared by an installed
+// platform's platform.txt via LoadPlatformDiscoveries, e.g.:
+//
+//	pluggable_discovery.required=arduino:mdns-discovery
+//	pluggable_discovery.required.1=arduino:ble-discovery
+type Registry struct {
+	discoveries map[string]*Discovery
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{discoveries: map[string]*Discovery{}}
+}
+
+// Register adds an already-instantiated discovery to the registry under id,
+// replacing any discovery previously registered under the same id.
+func (r *Registry) Register(id string, disc *Discovery) {
+	r.discoveries[id] = disc
+}
+
+// ToolInstaller downloads and installs a tool release, reporting progress
+// through implementation-specific means (a progress bar, a task list, ...).
+// It's satisfied by core.DownloadToolRelease/core.InstallToolRelease bound
+// to whatever progress reporters the caller's UI uses.
+type ToolInstaller func(pm *packagemanager.PackageManager, tool *cores.ToolRelease)
+
+// LoadPlatformDiscoveries scans every installed platform's platform.txt for
+// pluggable_discovery.required(.N) properties, and registers a Discovery
+// for each referenced tool, downloading and installing it first via
+// download/install when it isn't already installed (mirroring the bootstrap
+// historically done for the builtin serial-discovery alone).
+//
+// A platform whose discovery tool can't be found, installed, or started is
+// skipped rather than aborting the whole load: one platform's optional
+// discovery shouldn't take down board list for everyone else. Each skip is
+// reported back as a warning, the same way per-discovery List() errors are
+// reported non-fatally by the caller.
+func (r *Registry) LoadPlatformDiscoveries(pm *packagemanager.PackageManager, download, install ToolInstaller) []error {
+	var warnings []error
+	for _, targetPackage := range pm.GetPackages().Packages {
+		for _, platform := range targetPackage.Platforms {
+			installed := pm.GetInstalledPlatformRelease(platform)
+			if installed == nil {
+				continue
+			}
+			for _, toolRef := range installed.Properties.ExtractSubIndexLists("pluggable_discovery.required") {
+				tool := pm.FindToolDependency(targetPackage, toolRef)
+				if tool == nil {
+					warnings = append(warnings, fmt.Errorf("discovery tool not found: %s", toolRef))
+					continue
+				}
+				if !tool.IsInstalled() {
+					download(pm, tool)
+					install(pm, tool)
+					if !tool.IsInstalled() {
+						warnings = append(warnings, fmt.Errorf("installing discovery tool: %s", tool.String()))
+						continue
+					}
+				}
+
+				exe := tool.InstallDir.Join(tool.Tool.Name).String()
+				disc, err := NewFromCommandLine(exe)
+				if err != nil {
+					warnings = append(warnings, fmt.Errorf("starting discovery %s: %w", toolRef, err))
+					continue
+				}
+				r.Register(discoveryID(tool.Tool.Name), disc)
+			}
+		}
+	}
+	return warnings
+}
+
+// discoveryID derives a short registry id from a discovery tool's name by
+// trimming the "-discovery" suffix, e.g. "mdns-discovery" becomes "mdns"
+// and "ble-discovery" becomes "ble". This is the id board list
+// --discovery-filter matches against; there's no separate protocol/category
+// label, so filter values must match actual installed tool names, not the
+// protocol they happen to implement (the builtin serial one is the one
+// exception, registered under the fixed id "serial").
+func discoveryID(toolName string) string {
+	return strings.TrimSuffix(toolName, "-discovery")
+}
+
+// All returns every registered discovery, keyed by id.
+func (r *Registry) All() map[string]*Discovery {
+	return r.discoveries
+}
+
+// Filtered returns the subset of registered discoveries whose id is in ids.
+// An empty ids means no filtering: every discovery is returned.
+func (r *Registry) Filtered(ids []string) map[string]*Discovery {
+	if len(ids) == 0 {
+		return r.discoveries
+	}
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[strings.TrimSpace(id)] = true
+	}
+	res := map[string]*Discovery{}
+	for id, disc := range r.discoveries {
+		if wanted[id] {
+			res[id] = disc
+		}
+	}
+	return res
+}
+
+// Close closes every registered discovery.
+func (r *Registry) Close() {
+	for _, disc := range r.discoveries {
+		disc.Close()
+	}
+}
@@ -18,11 +18,14 @@
 package board
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"sort"
 	"time"
 
+	"github.com/arduino/arduino-cli/arduino/cores"
+	"github.com/arduino/arduino-cli/arduino/cores/packagemanager"
 	"github.com/arduino/arduino-cli/arduino/discovery"
 	"github.com/arduino/arduino-cli/cli"
 	"github.com/arduino/arduino-cli/commands/core"
@@ -43,11 +46,18 @@ func initListCommand() *cobra.Command {
 
 	listCommand.Flags().StringVar(&listFlags.timeout, "timeout", "1s",
 		"The timeout of the search of connected devices, try to increase it if your board is not found (e.g. to 10s).")
+	listCommand.Flags().BoolVar(&listFlags.watch, "watch", false,
+		"Command keeps running and prints list of connected boards every time there's a change.")
+	listCommand.Flags().StringSliceVar(&listFlags.discoveryFilter, "discovery-filter", nil,
+		"Restrict the search to the given discoveries, identified by tool name with the \"-discovery\" suffix "+
+			"dropped (e.g. serial,mdns,ble). Defaults to all available discoveries.")
 	return listCommand
 }
 
 var listFlags struct {
-	timeout string // Expressed in a parsable duration, is the timeout for the list and attach commands.
+	timeout         string   // Expressed in a parsable duration, is the timeout for the list and attach commands.
+	watch           bool     // If true, list keeps running and watches for changes in connected boards.
+	discoveryFilter []string // If not empty, restricts the query to the given discovery ids.
 }
 
 // runListCommand detects and lists the connected arduino boards
@@ -85,37 +95,50 @@ func runListCommand(cmd *cobra.Command, args []string) {
 		os.Exit(cli.ErrCoreConfig)
 	}
 
-	// Find all installed discoveries
-	discoveries := discovery.ExtractDiscoveriesFromPlatforms(pm)
-	discoveries["serial"] = serialDiscovery
+	// Build the registry of every discovery available to us: the builtin
+	// serial-discovery plus whatever additional discoveries (network, BLE, ...)
+	// the installed platforms declare in their platform.txt.
+	registry := discovery.NewRegistry()
+	registry.Register("serial", serialDiscovery)
+	download := func(pm *packagemanager.PackageManager, tool *cores.ToolRelease) {
+		core.DownloadToolRelease(pm, tool, cli.OutputProgressBar())
+	}
+	install := func(pm *packagemanager.PackageManager, tool *cores.ToolRelease) {
+		core.InstallToolRelease(pm, tool, cli.OutputTaskProgress())
+	}
+	for _, warning := range registry.LoadPlatformDiscoveries(pm, download, install) {
+		formatter.Print(fmt.Sprintf("Warning: skipping platform discovery: %s", warning))
+	}
+	defer registry.Close()
 
-	res := &detectedPorts{Ports: []*detectedPort{}}
-	for discName, disc := range discoveries {
+	discoveries := registry.Filtered(listFlags.discoveryFilter)
+	for _, disc := range discoveries {
 		disc.Timeout = timeout
 		disc.Start()
-		defer disc.Close()
+	}
 
+	if listFlags.watch {
+		watchPorts(pm, discoveries, timeout)
+		return
+	}
+
+	res := &detectedPorts{Ports: []*detectedPort{}}
+	for discName, disc := range discoveries {
+		status := DiscoveryStatus{Name: discName, ProtocolVersion: int(disc.ProtocolVersion())}
 		ports, err := disc.List()
 		if err != nil {
-			fmt.Printf("Error getting port list from discovery %s: %s\n", discName, err)
-			continue
-		}
-		for _, port := range ports {
-			b := detectedBoards{}
-			for _, board := range pm.IdentifyBoard(port.IdentificationPrefs) {
-				b = append(b, &detectedBoard{
-					Name: board.Name(),
-					FQBN: board.FQBN(),
-				})
+			status.State = "timeout"
+			if !errors.Is(err, discovery.ErrTimeout) {
+				status.State = "error"
 			}
-			p := &detectedPort{
-				Address:       port.Address,
-				Protocol:      port.Protocol,
-				ProtocolLabel: port.ProtocolLabel,
-				Boards:        b,
+			status.Error = err.Error()
+		} else {
+			status.State = "ok"
+			for _, port := range ports {
+				res.Ports = append(res.Ports, newDetectedPort(pm, port))
 			}
-			res.Ports = append(res.Ports, p)
 		}
+		res.DiscoveryStatuses = append(res.DiscoveryStatuses, status)
 	}
 
 	if cli.OutputJSONOrElse(res) {
@@ -123,8 +146,40 @@ func runListCommand(cmd *cobra.Command, args []string) {
 	}
 }
 
+// DiscoveryStatus reports the outcome of querying a single discovery for
+// `board list`, so that scripts consuming --format json can tell a working
+// discovery from one that crashed or timed out, instead of the failure
+// being silently dropped.
+type DiscoveryStatus struct {
+	Name            string `json:"name"`
+	ProtocolVersion int    `json:"protocol_version"`
+	State           string `json:"state"` // "ok", "error" or "timeout"
+	Error           string `json:"error,omitempty"`
+}
+
+// newDetectedPort converts a discovery.Port, together with the boards pm
+// identifies on it, into the detectedPort shape used for both the JSON and
+// terminal output of `board list`.
+func newDetectedPort(pm *packagemanager.PackageManager, port *discovery.Port) *detectedPort {
+	b := detectedBoards{}
+	for _, board := range pm.IdentifyBoard(port.Properties) {
+		b = append(b, &detectedBoard{
+			Name: board.Name(),
+			FQBN: board.FQBN(),
+		})
+	}
+	return &detectedPort{
+		Address:       port.Address,
+		Protocol:      port.Protocol,
+		ProtocolLabel: port.ProtocolLabel,
+		Boards:        b,
+		Error:         port.Error,
+	}
+}
+
 type detectedPorts struct {
-	Ports []*detectedPort `json:"ports"`
+	Ports             []*detectedPort   `json:"ports"`
+	DiscoveryStatuses []DiscoveryStatus `json:"discovery_statuses,omitempty"`
 }
 
 type detectedPort struct {
@@ -132,6 +187,7 @@ type detectedPort struct {
 	Protocol      string         `json:"protocol"`
 	ProtocolLabel string         `json:"protocol_label"`
 	Boards        detectedBoards `json:"boards"`
+	Error         string         `json:"error,omitempty"`
 }
 
 type detectedBoards []*detectedBoard
@@ -188,5 +244,23 @@ func (p detectedPorts) EmitTerminal() string {
 			table.AddRow(address, protocol, board, fqbn)
 		}
 	}
-	return table.Render()
+
+	out := table.Render()
+	if footer := p.failedDiscoveriesFooter(); footer != "" {
+		out += footer
+	}
+	return out
+}
+
+// failedDiscoveriesFooter summarizes discoveries that errored or timed out
+// while being queried, so a failure isn't silently missing from the table.
+func (p detectedPorts) failedDiscoveriesFooter() string {
+	footer := ""
+	for _, status := range p.DiscoveryStatuses {
+		if status.State == "ok" {
+			continue
+		}
+		footer += fmt.Sprintf("Warning: discovery %s %s: %s\n", status.Name, status.State, status.Error)
+	}
+	return footer
 }
@@ -0,0 +1,178 @@
+/*
+ * This file is part of arduino-cli.
+ *
+ * Copyright 2018 ARDUINO SA (http://www.arduino.cc/)
+ *
+ * This software is released under the GNU General Public License version 3,
+ * which covers the main part of arduino-cli.
+ * The terms of this license can be found at:
+ * https://www.gnu.org/licenses/gpl-3.0.en.html
+ *
+ * You can be released from the requirements of the above licenses by purchasing
+ * a commercial license. Buying such a license is mandatory if you want to modify or
+ * otherwise use the software for commercial activities involving the Arduino
+ * software without disclosing the source code of your own applications. To purchase
+ * a commercial license, send an email to license@arduino.cc.
+ */
+
+package board
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/arduino/arduino-cli/arduino/cores/packagemanager"
+	"github.com/arduino/arduino-cli/arduino/discovery"
+	"github.com/arduino/arduino-cli/cli"
+)
+
+// watchEvent is a discovery.Event tagged with the name of the discovery it
+// came from, so error messages and status reporting can refer to it.
+type watchEvent struct {
+	discName string
+	event    *discovery.Event
+}
+
+// watchState holds everything watchPorts redraws on every event: the known
+// ports and the last known status of each discovery being watched, so a
+// discovery crashing mid-watch is reported the same way a failure during a
+// one-shot `board list` is.
+type watchState struct {
+	ports    map[string]*detectedPort
+	statuses map[string]*DiscoveryStatus
+}
+
+// watchPorts implements `board list --watch`: it keeps running, printing the
+// list of connected boards every time a port is plugged in, unplugged, or a
+// discovery reports an error, until interrupted. Discoveries that
+// advertised START_SYNC support in their HELLO response are watched via
+// their event stream; the others are polled with LIST every timeout
+// interval instead.
+func watchPorts(pm *packagemanager.PackageManager, discoveries map[string]*discovery.Discovery, timeout time.Duration) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+
+	stopChan := make(chan struct{})
+	events := make(chan watchEvent, len(discoveries))
+
+	state := &watchState{
+		ports:    map[string]*detectedPort{},
+		statuses: map[string]*DiscoveryStatus{},
+	}
+
+	for discName, disc := range discoveries {
+		discName, disc := discName, disc
+		state.statuses[discName] = &DiscoveryStatus{Name: discName, ProtocolVersion: int(disc.ProtocolVersion()), State: "ok"}
+		if disc.SupportsSync() {
+			if err := disc.StartSync(); err != nil {
+				events <- watchEvent{discName: discName, event: &discovery.Event{Type: discovery.EventError, Message: err.Error()}}
+				continue
+			}
+			go func() {
+				for ev := range disc.EventChan() {
+					events <- watchEvent{discName: discName, event: ev}
+				}
+			}()
+		} else {
+			go pollDiscovery(discName, disc, timeout, events, stopChan)
+		}
+	}
+
+	for {
+		select {
+		case <-sigChan:
+			close(stopChan)
+			for _, disc := range discoveries {
+				disc.Close()
+			}
+			return
+		case we := <-events:
+			applyWatchEvent(pm, state, we)
+			printWatchState(state)
+		}
+	}
+}
+
+// pollDiscovery is the fallback for discoveries that don't support
+// START_SYNC: it calls List every timeout interval and diffs the result
+// against the previous call to synthesize add/remove events. A List error
+// is reported as an EventError rather than dropped, so it still surfaces in
+// the discovery status shown to the user.
+func pollDiscovery(discName string, disc *discovery.Discovery, timeout time.Duration, events chan<- watchEvent, stop <-chan struct{}) {
+	seen := map[string]*discovery.Port{}
+	ticker := time.NewTicker(timeout)
+	defer ticker.Stop()
+	for {
+		ports, err := disc.List()
+		if err != nil {
+			events <- watchEvent{discName: discName, event: &discovery.Event{Type: discovery.EventError, Message: err.Error()}}
+		} else {
+			next := map[string]*discovery.Port{}
+			for _, port := range ports {
+				next[port.Protocol+"|"+port.Address] = port
+			}
+			for key, port := range next {
+				if _, ok := seen[key]; !ok {
+					events <- watchEvent{discName: discName, event: &discovery.Event{Type: discovery.EventAdd, Port: port}}
+				}
+			}
+			for key, port := range seen {
+				if _, ok := next[key]; !ok {
+					events <- watchEvent{discName: discName, event: &discovery.Event{Type: discovery.EventRemove, Port: port}}
+				}
+			}
+			seen = next
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyWatchEvent updates the watch state in place to reflect a single
+// add/remove/error event: add/remove update the known-ports map, keyed by
+// "protocol|address", and mark the discovery healthy again; error marks the
+// discovery as failing without touching the ports already known about it.
+func applyWatchEvent(pm *packagemanager.PackageManager, state *watchState, we watchEvent) {
+	switch we.event.Type {
+	case discovery.EventAdd:
+		key := we.event.Port.Protocol + "|" + we.event.Port.Address
+		state.ports[key] = newDetectedPort(pm, we.event.Port)
+		state.statuses[we.discName].State = "ok"
+		state.statuses[we.discName].Error = ""
+	case discovery.EventRemove:
+		key := we.event.Port.Protocol + "|" + we.event.Port.Address
+		delete(state.ports, key)
+		state.statuses[we.discName].State = "ok"
+		state.statuses[we.discName].Error = ""
+	case discovery.EventError:
+		state.statuses[we.discName].State = "error"
+		state.statuses[we.discName].Error = we.event.Message
+	}
+}
+
+// printWatchState prints the current set of known ports and discovery
+// statuses, either as a single JSON event-stream line or by redrawing the
+// terminal table (with its failed-discoveries footer) in place.
+func printWatchState(state *watchState) {
+	res := &detectedPorts{Ports: []*detectedPort{}}
+	for _, p := range state.ports {
+		res.Ports = append(res.Ports, p)
+	}
+	for _, status := range state.statuses {
+		res.DiscoveryStatuses = append(res.DiscoveryStatuses, *status)
+	}
+	sort.Slice(res.Ports, res.Less)
+
+	if cli.OutputJSONOrElse(res) {
+		// Clear the previous table and redraw it in place.
+		fmt.Print("\033[H\033[2J")
+		fmt.Print(res.EmitTerminal())
+	}
+}